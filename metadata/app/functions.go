@@ -0,0 +1,149 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FunctionStageMutate marks a function that may change the rendered
+	// manifests it's given.
+	FunctionStageMutate = "mutate"
+	// FunctionStageValidate marks a function that only inspects the
+	// rendered manifests and fails the pipeline if they're invalid.
+	FunctionStageValidate = "validate"
+)
+
+var (
+	// ErrFunctionNameInvalid is the error where a function name is invalid.
+	ErrFunctionNameInvalid = errors.New("Function name is invalid")
+	// ErrFunctionExists is the error when trying to create a function that already exists.
+	ErrFunctionExists = errors.New("Function with name already exists")
+	// ErrFunctionNotExists is the error when trying to delete a function that doesn't exist.
+	ErrFunctionNotExists = errors.New("Function with name doesn't exist")
+	// ErrFunctionStageInvalid is the error where a function's stage is
+	// neither "mutate" nor "validate".
+	ErrFunctionStageInvalid = errors.New("Function stage must be \"mutate\" or \"validate\"")
+)
+
+// FunctionSelectorSpec narrows which rendered resources a FunctionSpec is
+// run against. A resource must match every non-empty field to be selected;
+// an empty FunctionSelectorSpec selects everything.
+type FunctionSelectorSpec struct {
+	// APIVersion is the apiVersion of resources to select, e.g. "apps/v1".
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Kind is the Kind of resources to select, e.g. "Deployment".
+	Kind string `json:"kind,omitempty"`
+	// Namespace is the namespace of resources to select.
+	Namespace string `json:"namespace,omitempty"`
+	// Labels is a set of labels resources must carry to be selected.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// FunctionSpec is a single step of the post-render function pipeline,
+// modeled on kpt function CRDs: a containerized function that mutates or
+// validates the resources it's given, streamed over its stdin/stdout.
+type FunctionSpec struct {
+	Name string `json:"-"`
+	// Image is the OCI reference of the containerized function, e.g.
+	// "gcr.io/kpt-fn/set-namespace:v0.4".
+	Image string `json:"image"`
+	// ConfigMap is inline functionConfig data passed to the function.
+	ConfigMap map[string]string `json:"configMap,omitempty"`
+	// ConfigPath is a path, relative to the app root, to a functionConfig
+	// manifest. ConfigMap and ConfigPath are mutually exclusive.
+	ConfigPath string `json:"configPath,omitempty"`
+	// Selectors restricts the function to resources matching any of the
+	// listed selectors. With no selectors, the function sees every
+	// resource.
+	Selectors []*FunctionSelectorSpec `json:"selectors,omitempty"`
+	// Stage is either "mutate" or "validate".
+	Stage string `json:"stage"`
+}
+
+// FunctionSpecs is a map of the function name to its FunctionSpec. Use
+// Spec.ResolveFunctionOrder, not map iteration, to get the pipeline's
+// execution order.
+type FunctionSpecs map[string]*FunctionSpec
+
+// GetFunction returns a populated FunctionSpec given a function name.
+func (s *Spec) GetFunction(name string) (*FunctionSpec, bool) {
+	functionSpec, ok := s.Functions[name]
+	if ok {
+		functionSpec.Name = name
+	}
+	return functionSpec, ok
+}
+
+// AddFunction adds the FunctionSpec to the app spec.
+func (s *Spec) AddFunction(functionSpec *FunctionSpec) error {
+	if functionSpec.Name == "" {
+		return ErrFunctionNameInvalid
+	}
+
+	if functionSpec.Stage != FunctionStageMutate && functionSpec.Stage != FunctionStageValidate {
+		return ErrFunctionStageInvalid
+	}
+
+	_, functionExists := s.Functions[functionSpec.Name]
+	if functionExists {
+		return ErrFunctionExists
+	}
+
+	s.Functions[functionSpec.Name] = functionSpec
+	return nil
+}
+
+// DeleteFunction removes the function from the app spec.
+func (s *Spec) DeleteFunction(name string) error {
+	_, functionExists := s.Functions[name]
+	if !functionExists {
+		return ErrFunctionNotExists
+	}
+
+	delete(s.Functions, name)
+	return nil
+}
+
+// ResolveFunctionOrder returns the names of s.Functions in pipeline
+// execution order: FunctionOrder first, then any remaining functions not
+// listed there, in lexicographic name order. Names in FunctionOrder that no
+// longer exist in s.Functions are skipped.
+func (s *Spec) ResolveFunctionOrder() []string {
+	seen := make(map[string]bool, len(s.FunctionOrder))
+	names := make([]string, 0, len(s.Functions))
+
+	for _, name := range s.FunctionOrder {
+		if _, ok := s.Functions[name]; !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	remaining := make([]string, 0, len(s.Functions)-len(names))
+	for name := range s.Functions {
+		if !seen[name] {
+			remaining = append(remaining, name)
+		}
+	}
+	sort.Strings(remaining)
+
+	return append(names, remaining...)
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package functions
+
+import (
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/metadata/app"
+)
+
+// loadFunctionConfig resolves fn's functionConfig: ConfigMap if set inline,
+// or the manifest at ConfigPath (relative to appRoot) otherwise. With
+// neither set, it returns a nil Resource and the function sees no
+// functionConfig, matching kpt's behavior for configless functions.
+func loadFunctionConfig(fs afero.Fs, appRoot string, fn *app.FunctionSpec) (Resource, error) {
+	if len(fn.ConfigMap) > 0 {
+		cfg := make(Resource, len(fn.ConfigMap))
+		for k, v := range fn.ConfigMap {
+			cfg[k] = v
+		}
+		return cfg, nil
+	}
+
+	if fn.ConfigPath == "" {
+		return nil, nil
+	}
+
+	data, err := afero.ReadFile(fs, filepath.Join(appRoot, fn.ConfigPath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading functionConfig for %q", fn.Name)
+	}
+
+	var cfg Resource
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "parsing functionConfig for %q", fn.Name)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package functions
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+
+	"github.com/pkg/errors"
+
+	"github.com/ksonnet/ksonnet/metadata/app"
+)
+
+// DockerRunner runs a FunctionSpec as a container with `docker run`,
+// streaming the input ResourceList (items and functionConfig) over the
+// container's stdin as JSON and reading the (possibly mutated) result back
+// from its stdout.
+type DockerRunner struct{}
+
+// Run implements Runner.
+func (DockerRunner) Run(fn *app.FunctionSpec, input *ResourceList) (*ResourceList, error) {
+	in, err := json.Marshal(input)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding input for function %q", fn.Name)
+	}
+
+	cmd := exec.Command("docker", "run", "--rm", "-i", fn.Image)
+	cmd.Stdin = bytes.NewReader(in)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "image %q: %s", fn.Image, stderr.String())
+	}
+
+	var output ResourceList
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, errors.Wrapf(err, "decoding output from function %q", fn.Name)
+	}
+
+	if fn.Stage == app.FunctionStageValidate {
+		return input, nil
+	}
+
+	return &output, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package functions runs an app's post-render function pipeline: a sequence
+// of containerized kpt-style functions that mutate or validate rendered
+// manifests. Nothing in the apply, show, or diff commands calls it.
+package functions
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/metadata/app"
+)
+
+// Runner executes a single FunctionSpec against the resources selected for
+// it and returns the (possibly mutated) result. Implementations are
+// responsible for honoring fn.Stage: a "validate" function must not change
+// its input.
+type Runner interface {
+	Run(fn *app.FunctionSpec, input *ResourceList) (*ResourceList, error)
+}
+
+// Pipeline runs an app's Functions over rendered manifests using a Runner,
+// which tests can swap for an in-process implementation instead of the
+// Docker runner used in production.
+type Pipeline struct {
+	runner  Runner
+	fs      afero.Fs
+	appRoot string
+}
+
+// NewPipeline returns a Pipeline that executes functions with runner.
+// fs/appRoot are used to resolve FunctionSpec.ConfigPath.
+func NewPipeline(runner Runner, fs afero.Fs, appRoot string) *Pipeline {
+	return &Pipeline{runner: runner, fs: fs, appRoot: appRoot}
+}
+
+// Run passes items through every name in order whose FunctionSpec has a
+// Stage matching stage, feeding each function's output to the next
+// function's input. order is expected to come from
+// app.Spec.ResolveFunctionOrder, which is what gives the pipeline its
+// declared execution order; names with no entry in fns are skipped. Within
+// each step, only the resources matching the function's Selectors are sent
+// to its Runner; everything else passes through untouched. It returns the
+// final resources after the whole pipeline has run.
+func (p *Pipeline) Run(order []string, fns app.FunctionSpecs, stage string, items []Resource) ([]Resource, error) {
+	for _, name := range order {
+		fn, ok := fns[name]
+		if !ok || fn.Stage != stage {
+			continue
+		}
+
+		selected, rest := selectResources(items, fn.Selectors)
+
+		functionConfig, err := loadFunctionConfig(p.fs, p.appRoot, fn)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := p.runner.Run(fn, &ResourceList{Items: selected, FunctionConfig: functionConfig})
+		if err != nil {
+			return nil, errors.Wrapf(err, "running function %q", name)
+		}
+
+		items = append(out.Items, rest...)
+	}
+
+	return items, nil
+}
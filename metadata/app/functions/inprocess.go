@@ -0,0 +1,46 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package functions
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ksonnet/ksonnet/metadata/app"
+)
+
+// InProcessRunner runs functions as plain Go funcs keyed by FunctionSpec
+// image, so tests can exercise a Pipeline without Docker. A test registers
+// the image references it expects to see and the behavior to run for each.
+type InProcessRunner map[string]func(input *ResourceList) (*ResourceList, error)
+
+// Run implements Runner.
+func (r InProcessRunner) Run(fn *app.FunctionSpec, input *ResourceList) (*ResourceList, error) {
+	impl, ok := r[fn.Image]
+	if !ok {
+		return nil, errors.Errorf("no in-process function registered for image %q", fn.Image)
+	}
+
+	output, err := impl(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if fn.Stage == app.FunctionStageValidate {
+		return input, nil
+	}
+
+	return output, nil
+}
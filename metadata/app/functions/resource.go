@@ -0,0 +1,93 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package functions
+
+import "github.com/ksonnet/ksonnet/metadata/app"
+
+// Resource is a single rendered Kubernetes manifest, decoded generically so
+// the pipeline can inspect apiVersion/kind/metadata for selector matching
+// without depending on the Kubernetes API types.
+type Resource map[string]interface{}
+
+// ResourceList is what a Runner exchanges with a function: the resources it
+// should act on, plus the function's resolved config. It mirrors the kpt
+// function wire format (a list of items alongside a functionConfig).
+type ResourceList struct {
+	Items          []Resource `json:"items"`
+	FunctionConfig Resource   `json:"functionConfig,omitempty"`
+}
+
+// selects reports whether resource matches every non-empty field of sel.
+func (sel *matchableSelector) selects(r Resource) bool {
+	if sel.APIVersion != "" && r["apiVersion"] != sel.APIVersion {
+		return false
+	}
+
+	if sel.Kind != "" && r["kind"] != sel.Kind {
+		return false
+	}
+
+	metadata, _ := r["metadata"].(map[string]interface{})
+
+	if sel.Namespace != "" {
+		if metadata == nil || metadata["namespace"] != sel.Namespace {
+			return false
+		}
+	}
+
+	if len(sel.Labels) > 0 {
+		var labels map[string]interface{}
+		if metadata != nil {
+			labels, _ = metadata["labels"].(map[string]interface{})
+		}
+
+		for k, v := range sel.Labels {
+			if labels == nil || labels[k] != v {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+type matchableSelector app.FunctionSelectorSpec
+
+// selectResources splits items into those matching at least one of
+// selectors and the rest. With no selectors, every item matches.
+func selectResources(items []Resource, selectors []*app.FunctionSelectorSpec) (selected, unselected []Resource) {
+	if len(selectors) == 0 {
+		return items, nil
+	}
+
+	for _, r := range items {
+		matched := false
+		for _, sel := range selectors {
+			if (*matchableSelector)(sel).selects(r) {
+				matched = true
+				break
+			}
+		}
+
+		if matched {
+			selected = append(selected, r)
+		} else {
+			unselected = append(unselected, r)
+		}
+	}
+
+	return selected, unselected
+}
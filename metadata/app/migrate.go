@@ -0,0 +1,180 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Migrator upgrades a Spec from one APIVersion to the next. Migrators are
+// chained together by migrate to bring an on-disk spec of any known older
+// version up to DefaultAPIVersion without the user ever seeing an
+// "unsupported spec version" error.
+type Migrator interface {
+	// From is the APIVersion this migrator upgrades from.
+	From() string
+	// To is the APIVersion this migrator upgrades to.
+	To() string
+	// Migrate returns the spec upgraded to To(). It may mutate and return
+	// the same spec.
+	Migrate(*Spec) (*Spec, error)
+}
+
+// migrators is the registered set of upgrade steps, in no particular order;
+// migrate walks them to find the shortest path from a spec's on-disk
+// version to DefaultAPIVersion.
+//
+// History:
+//   - 0.0.1 -> 0.1.0: librariesMigrator ensures Libraries is present.
+//   - 0.1.0 -> 0.2.0: registryGitVersionMigrator copies a registry's
+//     GitVersion down to libraries that don't declare their own.
+//   - 0.2.0 -> 0.3.0: destinationsMigrator converts single-destination
+//     environments into the multi-destination shape.
+var migrators = []Migrator{
+	librariesMigrator{},
+	registryGitVersionMigrator{},
+	destinationsMigrator{},
+}
+
+// migrate walks the registered migrators to bring spec up to
+// DefaultAPIVersion, marking it dirty if any migrator ran. If spec is
+// already at DefaultAPIVersion, it is returned unchanged. If spec is newer
+// than DefaultAPIVersion, or no migration path exists, migrate returns an
+// error.
+func migrate(spec *Spec) (*Spec, error) {
+	if spec.APIVersion == DefaultAPIVersion {
+		return spec, nil
+	}
+
+	chain, err := resolveMigrationChain(spec.APIVersion, DefaultAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"Current app uses unsupported spec version '%s' (this client only supports %s): %s",
+			spec.APIVersion, DefaultAPIVersion, err)
+	}
+
+	for _, m := range chain {
+		spec, err = m.Migrate(spec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migrating app spec from %s to %s", m.From(), m.To())
+		}
+		spec.APIVersion = m.To()
+	}
+
+	spec.dirty = true
+	return spec, nil
+}
+
+// resolveMigrationChain finds the shortest sequence of registered migrators
+// that upgrades from version `from` to version `to`.
+func resolveMigrationChain(from, to string) ([]Migrator, error) {
+	type step struct {
+		version string
+		path    []Migrator
+	}
+
+	visited := map[string]bool{from: true}
+	queue := []step{{version: from}}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		for _, m := range migrators {
+			if m.From() != cur.version {
+				continue
+			}
+
+			path := append(append([]Migrator{}, cur.path...), m)
+			if m.To() == to {
+				return path, nil
+			}
+
+			if !visited[m.To()] {
+				visited[m.To()] = true
+				queue = append(queue, step{version: m.To(), path: path})
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no migration path from %s to %s", from, to)
+}
+
+// librariesMigrator ensures the Libraries field exists on specs written
+// before it was introduced.
+type librariesMigrator struct{}
+
+func (librariesMigrator) From() string { return "0.0.1" }
+func (librariesMigrator) To() string   { return "0.1.0" }
+
+func (librariesMigrator) Migrate(s *Spec) (*Spec, error) {
+	if s.Libraries == nil {
+		s.Libraries = LibraryRefSpecs{}
+	}
+
+	return s, nil
+}
+
+// registryGitVersionMigrator promotes a registry's GitVersion down to each
+// of its libraries that doesn't already declare its own, matching the
+// per-library GitVersion shape that replaced the registry-wide default.
+type registryGitVersionMigrator struct{}
+
+func (registryGitVersionMigrator) From() string { return "0.1.0" }
+func (registryGitVersionMigrator) To() string   { return "0.2.0" }
+
+func (registryGitVersionMigrator) Migrate(s *Spec) (*Spec, error) {
+	for _, lib := range s.Libraries {
+		if lib.GitVersion != nil {
+			continue
+		}
+
+		reg, ok := s.Registries[lib.Registry]
+		if !ok || reg.GitVersion == nil {
+			continue
+		}
+
+		gitVersion := *reg.GitVersion
+		lib.GitVersion = &gitVersion
+	}
+
+	return s, nil
+}
+
+// destinationsMigrator converts a single-destination environment into the
+// multi-destination shape, so callers only ever need to range over
+// EnvironmentSpec.Destinations (or call AllDestinations).
+type destinationsMigrator struct{}
+
+func (destinationsMigrator) From() string { return "0.2.0" }
+func (destinationsMigrator) To() string   { return "0.3.0" }
+
+func (destinationsMigrator) Migrate(s *Spec) (*Spec, error) {
+	for _, env := range s.Environments {
+		if len(env.Destinations) == 0 && env.Destination != nil {
+			env.Destinations = []*EnvironmentDestinationSpec{env.Destination}
+			// Destination and Destinations are mutually exclusive; clear the
+			// legacy field now that it's been carried over, or
+			// validateDestinations rejects the migrated environment with
+			// ErrDestinationSpecConflict for setting both.
+			env.Destination = nil
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package order
+
+import "sort"
+
+// KindOrder lists Kubernetes Kinds in the default install order: CRDs,
+// namespaces, RBAC, configmaps/secrets, workloads, then services and
+// ingresses. It is the fallback used once a component's rendered Kind is
+// known and neither an explicit Order nor Dependencies were given for its
+// environment.
+var KindOrder = []string{
+	"CustomResourceDefinition",
+	"Namespace",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"ServiceAccount",
+	"ConfigMap",
+	"Secret",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Deployment",
+	"StatefulSet",
+	"DaemonSet",
+	"ReplicaSet",
+	"Pod",
+	"Job",
+	"CronJob",
+	"Service",
+	"Ingress",
+}
+
+// kindPriority returns kind's index in KindOrder, or len(KindOrder) for a
+// kind that isn't listed, so unrecognized kinds sort after every known one.
+func kindPriority(kind string) int {
+	for i, k := range KindOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(KindOrder)
+}
+
+// SortByKind orders names by the default Kubernetes install order of their
+// Kind, as reported by kindOf. Names with the same priority keep their
+// relative order from the input slice.
+func SortByKind(names []string, kindOf map[string]string) []string {
+	sorted := append([]string{}, names...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return kindPriority(kindOf[sorted[i]]) < kindPriority(kindOf[sorted[j]])
+	})
+	return sorted
+}
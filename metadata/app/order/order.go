@@ -0,0 +1,114 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package order topologically sorts a ksonnet environment's components so
+// they can be applied (and, in reverse, deleted) in a safe order instead of
+// arbitrary map iteration order.
+package order
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ErrCycle is returned by TopoSort when the dependency graph contains a
+// cycle, making no valid order possible.
+type ErrCycle struct {
+	// Cycle is the list of nodes that form the cycle, in order.
+	Cycle []string
+}
+
+func (e *ErrCycle) Error() string {
+	return fmt.Sprintf("dependency cycle detected: %v", e.Cycle)
+}
+
+// TopoSort returns nodes ordered so that every node appears after the nodes
+// it depends on, as declared in deps (node -> the nodes it depends on).
+// Nodes with no entry in deps, or whose dependencies aren't in nodes, are
+// treated as having no dependencies. The result is deterministic rather than
+// map order: nodes are visited in lexicographic order, and each is emitted
+// right after its own dependencies.
+func TopoSort(nodes []string, deps map[string][]string) ([]string, error) {
+	known := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		known[n] = true
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(nodes))
+	result := make([]string, 0, len(nodes))
+
+	sorted := append([]string{}, nodes...)
+	sort.Strings(sorted)
+
+	var path []string
+	var visit func(n string) error
+	visit = func(n string) error {
+		switch state[n] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, p := range path {
+				if p == n {
+					start = i
+					break
+				}
+			}
+			return &ErrCycle{Cycle: append(append([]string{}, path[start:]...), n)}
+		}
+
+		state[n] = visiting
+		path = append(path, n)
+
+		depsOf := append([]string{}, deps[n]...)
+		sort.Strings(depsOf)
+		for _, dep := range depsOf {
+			if !known[dep] {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[n] = visited
+		result = append(result, n)
+		return nil
+	}
+
+	for _, n := range sorted {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Reverse returns a copy of order reversed, suitable for deleting components
+// in the opposite order they were applied in.
+func Reverse(order []string) []string {
+	reversed := make([]string, len(order))
+	for i, n := range order {
+		reversed[len(order)-1-i] = n
+	}
+	return reversed
+}
@@ -23,11 +23,15 @@ import (
 	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
 	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/metadata/app/order"
 )
 
 const (
 	// DefaultAPIVersion is the default ks API version to use if not specified.
-	DefaultAPIVersion = "0.1.0"
+	// It is the version that Read migrates every on-disk spec up to; see
+	// migrate.go for the history of what each version added.
+	DefaultAPIVersion = "0.3.0"
 	// Kind is the schema resource type.
 	Kind = "ksonnet.io/app"
 	// DefaultVersion is the default version of the app schema.
@@ -45,6 +49,24 @@ var (
 	ErrEnvironmentExists = fmt.Errorf("Environment with name already exists")
 	// ErrEnvironmentNotExists is the error when trying to update an environment that doesn't exist.
 	ErrEnvironmentNotExists = fmt.Errorf("Environment with name doesn't exist")
+	// ErrEnvironmentGroupNameInvalid is the error where an environment group name is invalid.
+	ErrEnvironmentGroupNameInvalid = fmt.Errorf("Environment group name is invalid")
+	// ErrEnvironmentGroupExists is the error when trying to create an environment group that already exists.
+	ErrEnvironmentGroupExists = fmt.Errorf("Environment group with name already exists")
+	// ErrEnvironmentGroupNotExists is the error when trying to update an environment group that doesn't exist.
+	ErrEnvironmentGroupNotExists = fmt.Errorf("Environment group with name doesn't exist")
+	// ErrEnvironmentGroupMemberNotExists is the error when an environment group references an
+	// environment that isn't registered.
+	ErrEnvironmentGroupMemberNotExists = fmt.Errorf("Environment group references an environment that doesn't exist")
+	// ErrDestinationCollision is the error when two destinations in the same environment resolve to
+	// the same server and namespace.
+	ErrDestinationCollision = fmt.Errorf("Environment has two destinations with the same server and namespace")
+	// ErrDestinationSpecConflict is the error when an environment sets both the legacy Destination
+	// and the multi-cluster Destinations field; the two are mutually exclusive.
+	ErrDestinationSpecConflict = fmt.Errorf("Environment cannot set both destination and destinations")
+	// ErrRegistryCredentialInvalid is the error when a RegistryCredentialSpec sets zero or more than
+	// one credential type.
+	ErrRegistryCredentialInvalid = fmt.Errorf("Registry credentials must set exactly one of basic, token, sshKey, gcs, s3, or githubApp")
 )
 
 // Spec defines all the ksonnet project metadata. This includes details such as
@@ -62,11 +84,38 @@ type Spec struct {
 	Keywords     []string         `json:"keywords,omitempty"`
 	Registries   RegistryRefSpecs `json:"registries,omitempty"`
 	Environments EnvironmentSpecs `json:"environments,omitempty"`
-	Libraries    LibraryRefSpecs  `json:"libraries,omitempty"`
-	License      string           `json:"license,omitempty"`
+	// EnvironmentGroups lets users declare named aggregates of existing
+	// environments (e.g. `prod = [prod-eu, prod-us, prod-asia]`). Groups are
+	// stored and validated here; no command expands a group name into its
+	// member environments.
+	EnvironmentGroups EnvironmentGroupSpecs `json:"environmentGroups,omitempty"`
+	Libraries         LibraryRefSpecs       `json:"libraries,omitempty"`
+	// Secrets declares encrypted secret sources that resolve to plaintext
+	// only through the secrets subsystem's resolvers, never in app.yaml. See
+	// secretProviders for which providers currently have a resolver.
+	Secrets SecretRefSpecs `json:"secrets,omitempty"`
+	// Functions is the post-render function pipeline: containerized
+	// mutators/validators that the functions package's Pipeline runs over
+	// rendered manifests. The apply, show, and diff commands do not run it.
+	// Execution order is given by FunctionOrder; see ResolveFunctionOrder.
+	Functions FunctionSpecs `json:"functions,omitempty"`
+	// FunctionOrder is the explicit pipeline order for Functions. It exists
+	// because FunctionSpecs is a map, so the order entries are declared in
+	// app.yaml isn't preserved by the YAML decoder. Functions omitted from
+	// FunctionOrder run after every listed function, in lexicographic name
+	// order.
+	FunctionOrder []string `json:"functionOrder,omitempty"`
+	License       string   `json:"license,omitempty"`
+
+	// dirty is set by Read when the on-disk spec was migrated to
+	// DefaultAPIVersion, so Write knows to persist the migrated form.
+	dirty bool
 }
 
-// Read will return the specification for a ksonnet application.
+// Read will return the specification for a ksonnet application. If the
+// on-disk spec is older than DefaultAPIVersion, Read migrates it in memory,
+// writes a `.bak` copy of the original file, and persists the migrated spec
+// so the user only pays the upgrade cost once.
 func Read(fs afero.Fs, appRoot string) (*Spec, error) {
 	bytes, err := afero.ReadFile(fs, specPath(appRoot))
 	if err != nil {
@@ -78,6 +127,21 @@ func Read(fs afero.Fs, appRoot string) (*Spec, error) {
 		return nil, err
 	}
 
+	schema, err = migrate(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if schema.dirty {
+		if err := afero.WriteFile(fs, specPath(appRoot)+".bak", bytes, DefaultFilePermissions); err != nil {
+			return nil, errors.Wrap(err, "backing up app spec before migration")
+		}
+
+		if err := Write(fs, appRoot, schema); err != nil {
+			return nil, errors.Wrap(err, "writing migrated app spec")
+		}
+	}
+
 	if schema.Contributors == nil {
 		schema.Contributors = ContributorSpecs{}
 	}
@@ -94,6 +158,18 @@ func Read(fs afero.Fs, appRoot string) (*Spec, error) {
 		schema.Environments = EnvironmentSpecs{}
 	}
 
+	if schema.EnvironmentGroups == nil {
+		schema.EnvironmentGroups = EnvironmentGroupSpecs{}
+	}
+
+	if schema.Secrets == nil {
+		schema.Secrets = SecretRefSpecs{}
+	}
+
+	if schema.Functions == nil {
+		schema.Functions = FunctionSpecs{}
+	}
+
 	return schema, nil
 }
 
@@ -124,6 +200,96 @@ type RegistryRefSpec struct {
 	Protocol   string          `json:"protocol"`
 	URI        string          `json:"uri"`
 	GitVersion *GitVersionSpec `json:"gitVersion"`
+	// Credentials describes how to authenticate to a private registry. It
+	// is nil for public registries. Every secret value it carries is a
+	// reference (by name) into Spec.Secrets rather than an inline literal.
+	Credentials *RegistryCredentialSpec `json:"credentials,omitempty"`
+}
+
+// RegistryCredentialSpec is a discriminated union of the ways ksonnet can
+// authenticate to a private registry. Exactly one field must be set.
+type RegistryCredentialSpec struct {
+	Basic     *BasicCredentialSpec     `json:"basic,omitempty"`
+	Token     *TokenCredentialSpec     `json:"token,omitempty"`
+	SSHKey    *SSHKeyCredentialSpec    `json:"sshKey,omitempty"`
+	GCS       *GCSCredentialSpec       `json:"gcs,omitempty"`
+	S3        *S3CredentialSpec        `json:"s3,omitempty"`
+	GitHubApp *GitHubAppCredentialSpec `json:"githubApp,omitempty"`
+}
+
+// BasicCredentialSpec is a username/password credential, e.g. for Git over
+// HTTPS or a Docker registry.
+type BasicCredentialSpec struct {
+	Username string `json:"username"`
+	// PasswordSecretRef is the name of a Spec.Secrets entry holding the
+	// password.
+	PasswordSecretRef string `json:"passwordSecretRef"`
+}
+
+// TokenCredentialSpec is a bearer token credential, e.g. a GitHub personal
+// access token.
+type TokenCredentialSpec struct {
+	// TokenSecretRef is the name of a Spec.Secrets entry holding the token.
+	TokenSecretRef string `json:"tokenSecretRef"`
+}
+
+// SSHKeyCredentialSpec is an SSH private key credential, e.g. for Git over
+// SSH.
+type SSHKeyCredentialSpec struct {
+	// Path is the path to the SSH private key, relative to the app root.
+	Path string `json:"path"`
+	// PassphraseSecretRef is the name of a Spec.Secrets entry holding the
+	// key's passphrase, if any.
+	PassphraseSecretRef string `json:"passphraseSecretRef,omitempty"`
+}
+
+// GCSCredentialSpec authenticates to a GCS-backed registry with a service
+// account.
+type GCSCredentialSpec struct {
+	// ServiceAccountSecretRef is the name of a Spec.Secrets entry holding the
+	// service account JSON key.
+	ServiceAccountSecretRef string `json:"serviceAccountSecretRef"`
+}
+
+// S3CredentialSpec authenticates to an S3-backed registry with a service
+// account.
+type S3CredentialSpec struct {
+	// ServiceAccountSecretRef is the name of a Spec.Secrets entry holding the
+	// service account JSON key.
+	ServiceAccountSecretRef string `json:"serviceAccountSecretRef"`
+}
+
+// GitHubAppCredentialSpec authenticates to a GitHub-backed registry as a
+// GitHub App installation.
+type GitHubAppCredentialSpec struct {
+	AppID          string `json:"appId"`
+	InstallationID string `json:"installationId"`
+	// PrivateKeySecretRef is the name of a Spec.Secrets entry holding the
+	// app's private key.
+	PrivateKeySecretRef string `json:"privateKeySecretRef"`
+}
+
+// validate checks that exactly one credential type is set.
+func (c *RegistryCredentialSpec) validate() error {
+	set := 0
+	for _, isSet := range []bool{
+		c.Basic != nil,
+		c.Token != nil,
+		c.SSHKey != nil,
+		c.GCS != nil,
+		c.S3 != nil,
+		c.GitHubApp != nil,
+	} {
+		if isSet {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return ErrRegistryCredentialInvalid
+	}
+
+	return nil
 }
 
 // RegistryRefSpecs is a map of the registry name to a RegistryRefSpec.
@@ -143,10 +309,26 @@ type EnvironmentSpec struct {
 	// environment.
 	Path string `json:"path"`
 	// Destination stores the cluster address that this environment points to.
+	// Deprecated: use Destinations for environments that fan out to more than
+	// one cluster. Destination is still accepted, and AllDestinations falls
+	// back to it, but Read migrates a spec older than 0.3.0 by moving
+	// Destination into Destinations and rewriting app.yaml.
 	Destination *EnvironmentDestinationSpec `json:"destination"`
+	// Destinations stores the cluster addresses that this environment points
+	// to; AllDestinations returns them. The apply, diff, and show commands do
+	// not read this field. Destination and Destinations are mutually
+	// exclusive.
+	Destinations []*EnvironmentDestinationSpec `json:"destinations,omitempty"`
 	// Targets contain the relative component paths that this environment
 	// wishes to deploy on it's destination.
 	Targets []string `json:"targets,omitempty"`
+	// Dependencies maps a component (by its Targets entry) to the components
+	// it must be applied after. It is consulted by ResolveApplyOrder when
+	// Order is not set.
+	Dependencies map[string][]string `json:"dependencies,omitempty"`
+	// Order, when set, is the explicit apply order for Targets and takes
+	// precedence over Dependencies.
+	Order []string `json:"order,omitempty"`
 }
 
 // EnvironmentDestinationSpec contains the specification for the cluster
@@ -157,8 +339,39 @@ type EnvironmentDestinationSpec struct {
 	// Namespace is the namespace of the Kubernetes server that targets should
 	// be deployed to. This is "default", if not specified.
 	Namespace string `json:"namespace"`
+	// Context is the name of this destination within a multi-destination
+	// environment (e.g. "prod-eu"). It is unused for single-destination
+	// environments.
+	Context string `json:"context,omitempty"`
 }
 
+// AllDestinations returns every destination this environment points to,
+// preferring the multi-destination Destinations list when it is set and
+// falling back to the single Destination for backwards compatibility.
+func (e *EnvironmentSpec) AllDestinations() []*EnvironmentDestinationSpec {
+	if len(e.Destinations) > 0 {
+		return e.Destinations
+	}
+
+	if e.Destination != nil {
+		return []*EnvironmentDestinationSpec{e.Destination}
+	}
+
+	return nil
+}
+
+// EnvironmentGroupSpec is a named aggregate of environments. Nothing that
+// operates on a single environment accepts a group name in its place.
+type EnvironmentGroupSpec struct {
+	// Environments lists the member environment names. Every name must refer
+	// to an environment already registered on the app spec.
+	Environments []string `json:"environments"`
+}
+
+// EnvironmentGroupSpecs is a map of the environment group name to its
+// EnvironmentGroupSpec.
+type EnvironmentGroupSpecs map[string]*EnvironmentGroupSpec
+
 // LibraryRefSpec is the specification for a library part.
 type LibraryRefSpec struct {
 	Name       string          `json:"name"`
@@ -222,6 +435,12 @@ func (s *Spec) AddRegistryRef(registryRefSpec *RegistryRefSpec) error {
 		return ErrRegistryNameInvalid
 	}
 
+	if registryRefSpec.Credentials != nil {
+		if err := registryRefSpec.Credentials.validate(); err != nil {
+			return err
+		}
+	}
+
 	_, registryRefExists := s.Registries[registryRefSpec.Name]
 	if registryRefExists {
 		return ErrRegistryExists
@@ -236,19 +455,14 @@ func (s *Spec) validate() error {
 		return errors.New("invalid version")
 	}
 
-	compatVer, _ := semver.Make(DefaultAPIVersion)
-	ver, err := semver.Make(s.APIVersion)
-	if err != nil {
+	// Compatibility with DefaultAPIVersion is no longer decided here: a spec
+	// with an older or newer APIVersion is handled by the migration pipeline
+	// in migrate.go, which either upgrades it or reports that no migration
+	// path exists.
+	if _, err := semver.Make(s.APIVersion); err != nil {
 		return errors.Wrap(err, "Failed to parse version in app spec")
 	}
 
-	if compatVer.Compare(ver) < 0 {
-		return fmt.Errorf(
-			"Current app uses unsupported spec version '%s' (this client only supports %s)",
-			s.APIVersion,
-			DefaultAPIVersion)
-	}
-
 	return nil
 }
 
@@ -283,16 +497,85 @@ func (s *Spec) AddEnvironmentSpec(spec *EnvironmentSpec) error {
 		return ErrEnvironmentExists
 	}
 
+	if err := validateDestinations(spec); err != nil {
+		return err
+	}
+
 	s.Environments[spec.Name] = spec
 	return nil
 }
 
-// DeleteEnvironmentSpec removes the environment specification from the app spec.
+// validateDestinations ensures that Destination and Destinations aren't both
+// set, and that none of an environment's destinations collide, i.e. that no
+// two destinations share the same server and namespace.
+func validateDestinations(spec *EnvironmentSpec) error {
+	if spec.Destination != nil && len(spec.Destinations) > 0 {
+		return ErrDestinationSpecConflict
+	}
+
+	seen := make(map[string]bool)
+
+	add := func(d *EnvironmentDestinationSpec) error {
+		if d == nil {
+			return nil
+		}
+
+		key := d.Server + "/" + d.Namespace
+		if seen[key] {
+			return ErrDestinationCollision
+		}
+		seen[key] = true
+		return nil
+	}
+
+	if err := add(spec.Destination); err != nil {
+		return err
+	}
+
+	for _, d := range spec.Destinations {
+		if err := add(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteEnvironmentSpec removes the environment specification from the app
+// spec, and prunes it from any EnvironmentGroups that reference it so a
+// deleted environment doesn't leave a dangling group member behind.
 func (s *Spec) DeleteEnvironmentSpec(name string) error {
 	delete(s.Environments, name)
+	s.removeEnvironmentFromGroups(name)
 	return nil
 }
 
+// removeEnvironmentFromGroups strips name from every EnvironmentGroupSpec's
+// Environments list.
+func (s *Spec) removeEnvironmentFromGroups(name string) {
+	for _, group := range s.EnvironmentGroups {
+		kept := group.Environments[:0]
+		for _, envName := range group.Environments {
+			if envName != name {
+				kept = append(kept, envName)
+			}
+		}
+		group.Environments = kept
+	}
+}
+
+// renameEnvironmentInGroups replaces oldName with newName in every
+// EnvironmentGroupSpec's Environments list.
+func (s *Spec) renameEnvironmentInGroups(oldName, newName string) {
+	for _, group := range s.EnvironmentGroups {
+		for i, envName := range group.Environments {
+			if envName == oldName {
+				group.Environments[i] = newName
+			}
+		}
+	}
+}
+
 // UpdateEnvironmentSpec updates the environment with the provided name to the
 // specified spec.
 func (s *Spec) UpdateEnvironmentSpec(name string, spec *EnvironmentSpec) error {
@@ -305,12 +588,114 @@ func (s *Spec) UpdateEnvironmentSpec(name string, spec *EnvironmentSpec) error {
 		return errors.Errorf("Environment with name %q does not exist", name)
 	}
 
+	if err := validateDestinations(spec); err != nil {
+		return err
+	}
+
 	if name != spec.Name {
-		if err := s.DeleteEnvironmentSpec(name); err != nil {
-			return err
-		}
+		delete(s.Environments, name)
+		s.renameEnvironmentInGroups(name, spec.Name)
 	}
 
 	s.Environments[spec.Name] = spec
 	return nil
 }
+
+// ResolveApplyOrder returns the order that the named environment's Targets
+// should be applied in.
+//
+// If the environment declares an explicit Order, that order is used as-is.
+// Otherwise, if it declares Dependencies, Targets are topologically sorted
+// so that every component is applied after the components it depends on; a
+// cycle in Dependencies is reported as an error. With neither set, Targets
+// fall back to the Kubernetes-native install order (CRDs, namespaces, RBAC,
+// configmaps/secrets, workloads, then services/ingresses) using kindOf to
+// look up each target's rendered Kind; a target missing from kindOf sorts
+// as if its Kind were unrecognized. Callers that haven't rendered manifests
+// yet (and so have no kindOf to offer) may pass a nil map, in which case
+// Targets are returned unchanged.
+//
+// Use order.Reverse on the result to get a safe delete order.
+func (s *Spec) ResolveApplyOrder(envName string, kindOf map[string]string) ([]string, error) {
+	env, ok := s.GetEnvironmentSpec(envName)
+	if !ok {
+		return nil, errors.Errorf("Environment with name %q does not exist", envName)
+	}
+
+	if len(env.Order) > 0 {
+		return env.Order, nil
+	}
+
+	if len(env.Dependencies) > 0 {
+		return order.TopoSort(env.Targets, env.Dependencies)
+	}
+
+	if len(kindOf) > 0 {
+		return order.SortByKind(env.Targets, kindOf), nil
+	}
+
+	return env.Targets, nil
+}
+
+// GetEnvironmentGroupSpec returns the environment group specification for the
+// named group.
+func (s *Spec) GetEnvironmentGroupSpec(name string) (*EnvironmentGroupSpec, bool) {
+	groupSpec, ok := s.EnvironmentGroups[name]
+	return groupSpec, ok
+}
+
+// AddEnvironmentGroupSpec registers a new environment group under the
+// provided name. Every environment listed in the group must already be
+// registered on the app spec.
+func (s *Spec) AddEnvironmentGroupSpec(name string, spec *EnvironmentGroupSpec) error {
+	if name == "" {
+		return ErrEnvironmentGroupNameInvalid
+	}
+
+	_, environmentGroupExists := s.EnvironmentGroups[name]
+	if environmentGroupExists {
+		return ErrEnvironmentGroupExists
+	}
+
+	if err := s.validateEnvironmentGroupMembers(spec); err != nil {
+		return err
+	}
+
+	s.EnvironmentGroups[name] = spec
+	return nil
+}
+
+// UpdateEnvironmentGroupSpec updates the environment group with the provided
+// name to the specified spec.
+func (s *Spec) UpdateEnvironmentGroupSpec(name string, spec *EnvironmentGroupSpec) error {
+	_, environmentGroupExists := s.EnvironmentGroups[name]
+	if !environmentGroupExists {
+		return ErrEnvironmentGroupNotExists
+	}
+
+	if err := s.validateEnvironmentGroupMembers(spec); err != nil {
+		return err
+	}
+
+	s.EnvironmentGroups[name] = spec
+	return nil
+}
+
+// DeleteEnvironmentGroupSpec removes the environment group from the app
+// spec.
+func (s *Spec) DeleteEnvironmentGroupSpec(name string) error {
+	delete(s.EnvironmentGroups, name)
+	return nil
+}
+
+// validateEnvironmentGroupMembers checks that every environment referenced by
+// a group is already registered on the app spec.
+func (s *Spec) validateEnvironmentGroupMembers(spec *EnvironmentGroupSpec) error {
+	for _, envName := range spec.Environments {
+		if _, ok := s.Environments[envName]; !ok {
+			return errors.Wrapf(ErrEnvironmentGroupMemberNotExists, "environment %q", envName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import "github.com/pkg/errors"
+
+const (
+	// SecretProviderSops identifies a secret encrypted at rest with SOPS.
+	// Reserved: no resolver is registered for it yet, so AddSecretRef
+	// rejects it until metadata/app/secrets grows a sops.Resolver.
+	SecretProviderSops = "sops"
+	// SecretProviderVault identifies a secret stored in Hashicorp Vault.
+	// Reserved: no resolver is registered for it yet, so AddSecretRef
+	// rejects it until metadata/app/secrets grows a vault.Resolver.
+	SecretProviderVault = "vault"
+	// SecretProviderSealedSecret identifies a secret stored as a
+	// bitnami-labs/sealed-secrets CRD. Reserved: no resolver is registered
+	// for it yet, so AddSecretRef rejects it until metadata/app/secrets
+	// grows a sealedsecret.Resolver.
+	SecretProviderSealedSecret = "sealedsecret"
+	// SecretProviderFile identifies a secret stored in a GPG-encrypted YAML
+	// file on disk. It is the only provider with a resolver registered in
+	// metadata/app/secrets today.
+	SecretProviderFile = "file"
+)
+
+var (
+	// ErrSecretNameInvalid is the error where a secret name is invalid.
+	ErrSecretNameInvalid = errors.New("Secret name is invalid")
+	// ErrSecretExists is the error when trying to create a secret that already exists.
+	ErrSecretExists = errors.New("Secret with name already exists")
+	// ErrSecretNotExists is the error when trying to delete a secret that doesn't exist.
+	ErrSecretNotExists = errors.New("Secret with name doesn't exist")
+	// ErrSecretProviderInvalid is the error where a secret's provider is not one
+	// of the supported providers.
+	ErrSecretProviderInvalid = errors.New("Secret provider is invalid")
+)
+
+// secretProviders is the set of providers a SecretRefSpec may declare. It is
+// deliberately narrower than the full set of SecretProvider* constants:
+// AddSecretRef only accepts a provider once metadata/app/secrets has a
+// working resolver for it, so an unsupported provider is rejected here
+// instead of failing later, deep inside a fetch, with ErrResolverNotFound.
+var secretProviders = map[string]bool{
+	SecretProviderFile: true,
+}
+
+// SecretRefSpec is the specification for an encrypted secret source that is
+// declared in the app spec rather than the environment's component tree.
+// The secret value itself is never stored here; Path points at the
+// encrypted source that a resolver in the secrets package decrypts on
+// demand.
+type SecretRefSpec struct {
+	Name string `json:"-"`
+	// Provider must be a provider with a registered resolver; today that is
+	// only "file". "sops", "vault", and "sealedsecret" are reserved for
+	// when metadata/app/secrets grows resolvers for them.
+	Provider string `json:"provider"`
+	// Path is the location of the encrypted secret source, e.g. a file path
+	// for the "file" provider.
+	Path string `json:"path"`
+	// Recipients is the list of GPG recipients the secret is encrypted
+	// for. It is only meaningful for the "file" provider.
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+// SecretRefSpecs is a map of the secret name to its SecretRefSpec.
+type SecretRefSpecs map[string]*SecretRefSpec
+
+// GetSecretRef returns a populated SecretRefSpec given a secret name.
+func (s *Spec) GetSecretRef(name string) (*SecretRefSpec, bool) {
+	secretRefSpec, ok := s.Secrets[name]
+	if ok {
+		// Populate name, which we do not include in the deserialization
+		// process.
+		secretRefSpec.Name = name
+	}
+	return secretRefSpec, ok
+}
+
+// AddSecretRef adds the SecretRefSpec to the app spec.
+func (s *Spec) AddSecretRef(secretRefSpec *SecretRefSpec) error {
+	if secretRefSpec.Name == "" {
+		return ErrSecretNameInvalid
+	}
+
+	if !secretProviders[secretRefSpec.Provider] {
+		return errors.Wrapf(ErrSecretProviderInvalid, "provider %q", secretRefSpec.Provider)
+	}
+
+	_, secretRefExists := s.Secrets[secretRefSpec.Name]
+	if secretRefExists {
+		return ErrSecretExists
+	}
+
+	s.Secrets[secretRefSpec.Name] = secretRefSpec
+	return nil
+}
+
+// DeleteSecretRef removes the secret reference from the app spec.
+func (s *Spec) DeleteSecretRef(name string) error {
+	_, secretRefExists := s.Secrets[name]
+	if !secretRefExists {
+		return ErrSecretNotExists
+	}
+
+	delete(s.Secrets, name)
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package secrets
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/metadata/app"
+)
+
+// fileResolver resolves secrets stored as GPG-encrypted YAML files under
+// secrets/<env>/*.yaml, shelling out to the system `gpg` binary.
+type fileResolver struct{}
+
+func (fileResolver) Read(fs afero.Fs, appRoot string, ref *app.SecretRefSpec) ([]byte, error) {
+	ciphertext, err := afero.ReadFile(fs, filepath.Join(appRoot, ref.Path))
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading encrypted secret %q", ref.Name)
+	}
+
+	cmd := exec.Command("gpg", "--decrypt", "--quiet", "--batch")
+	cmd.Stdin = bytes.NewReader(ciphertext)
+
+	var plaintext bytes.Buffer
+	cmd.Stdout = &plaintext
+
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "decrypting secret %q", ref.Name)
+	}
+
+	return plaintext.Bytes(), nil
+}
+
+func (fileResolver) Write(fs afero.Fs, appRoot string, ref *app.SecretRefSpec, plaintext []byte) error {
+	args := []string{"--encrypt", "--armor", "--batch", "--yes"}
+	for _, recipient := range ref.Recipients {
+		args = append(args, "--recipient", recipient)
+	}
+
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdin = bytes.NewReader(plaintext)
+
+	var ciphertext bytes.Buffer
+	cmd.Stdout = &ciphertext
+
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "encrypting secret %q", ref.Name)
+	}
+
+	path := filepath.Join(appRoot, ref.Path)
+	if err := fs.MkdirAll(filepath.Dir(path), app.DefaultFolderPermissions); err != nil {
+		return errors.Wrapf(err, "creating directory for secret %q", ref.Name)
+	}
+
+	return afero.WriteFile(fs, path, ciphertext.Bytes(), app.DefaultFilePermissions)
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package secrets resolves the SecretRefSpec entries declared in an app's
+// app.yaml into plaintext, and re-encrypts plaintext back into the
+// underlying source. Resolvers never expose plaintext outside of Read/Write;
+// app.yaml itself only ever holds a provider and a path.
+package secrets
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/metadata/app"
+)
+
+// Resolver decrypts and re-encrypts the secret source referenced by a
+// SecretRefSpec. Implementations are registered per-provider in this
+// package's resolvers map, which Resolve looks up.
+type Resolver interface {
+	// Read decrypts the secret source and returns its plaintext contents.
+	Read(fs afero.Fs, appRoot string, ref *app.SecretRefSpec) ([]byte, error)
+	// Write re-encrypts plaintext and persists it to the secret source.
+	Write(fs afero.Fs, appRoot string, ref *app.SecretRefSpec, plaintext []byte) error
+}
+
+// ErrResolverNotFound is the error when no Resolver is registered for a
+// SecretRefSpec's provider.
+var ErrResolverNotFound = errors.New("no resolver registered for secret provider")
+
+var resolvers = map[string]Resolver{
+	app.SecretProviderFile: fileResolver{},
+}
+
+// Resolve returns the Resolver registered for ref's provider.
+func Resolve(ref *app.SecretRefSpec) (Resolver, error) {
+	resolver, ok := resolvers[ref.Provider]
+	if !ok {
+		return nil, errors.Wrap(ErrResolverNotFound, fmt.Sprintf("provider %q", ref.Provider))
+	}
+
+	return resolver, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 The kubecfg authors
+//
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package registry
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/afero"
+
+	"github.com/ksonnet/ksonnet/metadata/app"
+	"github.com/ksonnet/ksonnet/metadata/app/secrets"
+)
+
+// Credential holds the resolved, plaintext authentication material for a
+// registry. Only the fields relevant to the registry's credential type are
+// populated.
+type Credential struct {
+	Username string
+	Password string
+
+	Token string
+
+	SSHKeyPath       string
+	SSHKeyPassphrase string
+
+	ServiceAccountJSON string
+
+	GitHubAppID          string
+	GitHubInstallationID string
+	GitHubPrivateKey     string
+}
+
+// CredentialProvider resolves the credential a RegistryRefSpec declares,
+// fetched lazily so that registries without credentials never touch the
+// secrets subsystem. No registry fetch code in this package calls a
+// CredentialProvider.
+type CredentialProvider interface {
+	// Credential returns ref's resolved credential, or nil if ref declares
+	// no credentials.
+	Credential(ref *app.RegistryRefSpec) (*Credential, error)
+}
+
+// FilebasedCredentialProvider resolves RegistryCredentialSpec secret
+// references against an app's declared Spec.Secrets, decrypting each
+// through the secrets package's resolvers.
+type FilebasedCredentialProvider struct {
+	Fs      afero.Fs
+	AppRoot string
+	Spec    *app.Spec
+}
+
+// Credential implements CredentialProvider.
+func (p *FilebasedCredentialProvider) Credential(ref *app.RegistryRefSpec) (*Credential, error) {
+	if ref.Credentials == nil {
+		return nil, nil
+	}
+
+	c := ref.Credentials
+	switch {
+	case c.Basic != nil:
+		password, err := p.resolveSecret(c.Basic.PasswordSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return &Credential{Username: c.Basic.Username, Password: password}, nil
+
+	case c.Token != nil:
+		token, err := p.resolveSecret(c.Token.TokenSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return &Credential{Token: token}, nil
+
+	case c.SSHKey != nil:
+		passphrase, err := p.resolveOptionalSecret(c.SSHKey.PassphraseSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return &Credential{SSHKeyPath: c.SSHKey.Path, SSHKeyPassphrase: passphrase}, nil
+
+	case c.GCS != nil:
+		serviceAccount, err := p.resolveSecret(c.GCS.ServiceAccountSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return &Credential{ServiceAccountJSON: serviceAccount}, nil
+
+	case c.S3 != nil:
+		serviceAccount, err := p.resolveSecret(c.S3.ServiceAccountSecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return &Credential{ServiceAccountJSON: serviceAccount}, nil
+
+	case c.GitHubApp != nil:
+		privateKey, err := p.resolveSecret(c.GitHubApp.PrivateKeySecretRef)
+		if err != nil {
+			return nil, err
+		}
+		return &Credential{
+			GitHubAppID:          c.GitHubApp.AppID,
+			GitHubInstallationID: c.GitHubApp.InstallationID,
+			GitHubPrivateKey:     privateKey,
+		}, nil
+	}
+
+	return nil, errors.Errorf("registry %q declares credentials with no type set", ref.Name)
+}
+
+func (p *FilebasedCredentialProvider) resolveOptionalSecret(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	return p.resolveSecret(name)
+}
+
+func (p *FilebasedCredentialProvider) resolveSecret(name string) (string, error) {
+	secretRef, ok := p.Spec.GetSecretRef(name)
+	if !ok {
+		return "", errors.Errorf("secret %q referenced by registry credentials does not exist", name)
+	}
+
+	resolver, err := secrets.Resolve(secretRef)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := resolver.Read(p.Fs, p.AppRoot, secretRef)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// InmemCredentialProvider is a CredentialProvider backed by an in-memory
+// map of registry name to Credential, for use in tests in place of
+// FilebasedCredentialProvider.
+type InmemCredentialProvider map[string]*Credential
+
+// Credential implements CredentialProvider.
+func (p InmemCredentialProvider) Credential(ref *app.RegistryRefSpec) (*Credential, error) {
+	cred, ok := p[ref.Name]
+	if !ok {
+		if ref.Credentials == nil {
+			return nil, nil
+		}
+		return nil, errors.Errorf("no credential registered for registry %q", ref.Name)
+	}
+
+	return cred, nil
+}